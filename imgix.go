@@ -1,14 +1,20 @@
 package imgix
 
 import (
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"hash/crc32"
 	"net/url"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-	"unicode/utf8"
+	"time"
+
+	"github.com/parkr/imgix-go/internal/escape"
 )
 
 type ShardStrategy string
@@ -18,12 +24,22 @@ const (
 	ShardStrategyCycle = ShardStrategy(":cycle")
 )
 
+// SignatureAlgorithm selects the hashing algorithm used to sign imgix URLs.
+type SignatureAlgorithm string
+
+const (
+	// SignatureMD5 hashes the token, path, and params with MD5. It is the
+	// original imgix signing algorithm and remains the default so existing
+	// callers keep producing the same signatures.
+	SignatureMD5 = SignatureAlgorithm("md5")
+	// SignatureHMACSHA256 signs with HMAC-SHA256, keyed on the token,
+	// instead of a plain MD5 digest.
+	SignatureHMACSHA256 = SignatureAlgorithm("hmac-sha256")
+)
+
 // Matches http:// and https://
 var RegexpHTTPAndS = regexp.MustCompile("https?://")
 
-// Regexp for all characters we should escape in a URI passed in.
-var RegexUrlCharactersToEscape = regexp.MustCompile("([^ a-zA-Z0-9_.-])")
-
 // Create a new Client with the given hosts, with HTTPS enabled.
 func NewClient(hosts ...string) Client {
 	return Client{hosts: hosts, secure: true}
@@ -34,15 +50,28 @@ func NewClientWithToken(host string, token string) Client {
 	return Client{hosts: []string{host}, secure: true, token: token}
 }
 
+// Create a new Client with the given host, token, and signature algorithm.
+// HTTPS enabled.
+func NewClientWithTokenAndAlgorithm(host string, token string, algorithm SignatureAlgorithm) Client {
+	return Client{hosts: []string{host}, secure: true, token: token, signatureAlgorithm: algorithm}
+}
+
 // The Client is used to build URLs.
 type Client struct {
-	hosts         []string
-	token         string
-	secure        bool
-	shardStrategy ShardStrategy
+	hosts              []string
+	token              string
+	secure             bool
+	shardStrategy      ShardStrategy
+	signatureAlgorithm SignatureAlgorithm
 
 	// For use with ShardStrategyCycle
 	cycleIndex int
+
+	// When non-zero, Path and PathWithParams sign URLs with an expiry of
+	// DefaultExpiry from the time the URL is built, the same as calling
+	// PathWithExpiry with time.Now().Add(DefaultExpiry). Leave it at its
+	// zero value to keep producing signatures with no expiry.
+	DefaultExpiry time.Duration
 }
 
 // The sharding strategy used by this client.
@@ -59,6 +88,28 @@ func (c *Client) ShardStrategy() ShardStrategy {
 	}
 }
 
+// The signature algorithm used by this client. Defaults to SignatureMD5 for
+// backward compatibility.
+// Panics if the algorithm is not supported by this library.
+func (c *Client) SignatureAlgorithm() SignatureAlgorithm {
+	switch c.signatureAlgorithm {
+	case SignatureMD5, SignatureHMACSHA256:
+		return c.signatureAlgorithm
+	case "":
+		c.signatureAlgorithm = SignatureMD5
+		return c.signatureAlgorithm
+	default:
+		panic(fmt.Errorf("signature algorithm '%s' is not supported", c.signatureAlgorithm))
+	}
+}
+
+// SetSignatureAlgorithm changes the signature algorithm this client signs
+// URLs with. MD5 remains the default for backward compatibility; switch to
+// SignatureHMACSHA256 for a stronger signature.
+func (c *Client) SetSignatureAlgorithm(algorithm SignatureAlgorithm) {
+	c.signatureAlgorithm = algorithm
+}
+
 // Returns whether HTTPS should be used.
 func (c *Client) Secure() bool {
 	return c.secure
@@ -104,21 +155,81 @@ func (c *Client) SignatureForPath(path string) string {
 
 // Creates and returns the URL signature in the form of "s=SIGNATURE" for
 // the given parameters. Requires that the client have a token.
+//
+// The signature is computed with SignatureMD5 unless SetSignatureAlgorithm
+// (or NewClientWithTokenAndAlgorithm) has selected SignatureHMACSHA256.
 func (c *Client) SignatureForPathAndParams(path string, params url.Values) string {
 	if c.token == "" {
 		return ""
 	}
 
-	hasher := md5.New()
-	hasher.Write([]byte(c.token + path))
-
 	// Do not mix in the parameters into the signature hash if no parameters
 	// have been given
+	var payload string
 	if len(params) != 0 {
-		hasher.Write([]byte("?" + params.Encode()))
+		payload = "?" + c.encodeParamsForSignature(params)
+	}
+
+	return c.hashSignaturePayload(path, payload)
+}
+
+// Creates and returns the URL signature in the form of "s=SIGNATURE" for the
+// given parameters, mixing an "expires=<unix-seconds>" parameter into the
+// hashed payload so the signature commits to the expiry and can't be
+// extended by editing the query string. Requires that the client have a
+// token.
+func (c *Client) SignatureForPathAndParamsWithExpiry(path string, params url.Values, expires time.Time) string {
+	if c.token == "" {
+		return ""
+	}
+
+	paramsWithExpiry := cloneValues(params)
+	paramsWithExpiry.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+
+	return c.hashSignaturePayload(path, "?"+c.encodeParamsForSignature(paramsWithExpiry))
+}
+
+// encodeParamsForSignature encodes params into the query string that gets
+// mixed into a signature's hashed payload.
+//
+// SignatureHMACSHA256 sorts keys lexicographically and percent-encodes keys
+// and values, so the signature is stable no matter what order url.Values
+// happens to iterate in. SignatureMD5 keeps using url.Values' own Encode,
+// unchanged, for backward compatibility with existing signatures.
+func (c *Client) encodeParamsForSignature(params url.Values) string {
+	if c.SignatureAlgorithm() != SignatureHMACSHA256 {
+		return params.Encode()
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	return "s=" + hex.EncodeToString(hasher.Sum(nil))
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range params[key] {
+			parts = append(parts, escape.QueryEscape(key)+"="+escape.QueryEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// hashSignaturePayload hashes token+path+payload with this client's
+// SignatureAlgorithm and returns it in the form of "s=SIGNATURE".
+func (c *Client) hashSignaturePayload(path, payload string) string {
+	switch c.SignatureAlgorithm() {
+	case SignatureHMACSHA256:
+		mac := hmac.New(sha256.New, []byte(c.token))
+		mac.Write([]byte(path + payload))
+		return "s=" + hex.EncodeToString(mac.Sum(nil))
+	default:
+		hasher := md5.New()
+		hasher.Write([]byte(c.token + path))
+		hasher.Write([]byte(payload))
+		return "s=" + hex.EncodeToString(hasher.Sum(nil))
+	}
 }
 
 // Builds the full URL to the image (including the host) with no params.
@@ -132,6 +243,10 @@ func (c *Client) Path(imgPath string) string {
 //
 // The behavior of this function is highly dependent upon its test suite.
 func (c *Client) PathWithParams(imgPath string, params url.Values) string {
+	if c.DefaultExpiry != 0 {
+		return c.PathWithExpiry(imgPath, params, time.Now().Add(c.DefaultExpiry))
+	}
+
 	u := url.URL{
 		Scheme: c.Scheme(),
 		Host:   c.Host(imgPath),
@@ -140,9 +255,12 @@ func (c *Client) PathWithParams(imgPath string, params url.Values) string {
 	urlString := u.String()
 
 	// If we are given a fully-qualified URL, escape it per the note located
-	// near the `cgiEscape` function definition
+	// near the `escape.ProxyPathEscape` function definition; otherwise escape
+	// it as an ordinary path per `escape.PathEscape`.
 	if RegexpHTTPAndS.MatchString(imgPath) {
-		imgPath = cgiEscape(imgPath)
+		imgPath = escape.ProxyPathEscape(imgPath)
+	} else {
+		imgPath = escape.PathEscape(imgPath)
 	}
 
 	// Add a leading slash if one does not exist:
@@ -158,7 +276,7 @@ func (c *Client) PathWithParams(imgPath string, params url.Values) string {
 	// alphabetize the URL parameters.
 	signature := c.SignatureForPathAndParams(imgPath, params)
 	parameterString := params.Encode()
-	parameterString = strings.Replace(parameterString, "+", "%%20", -1)
+	parameterString = strings.Replace(parameterString, "+", "%20", -1)
 
 	if signature != "" && len(params) > 0 {
 		parameterString += "&" + signature
@@ -174,32 +292,108 @@ func (c *Client) PathWithParams(imgPath string, params url.Values) string {
 	return urlString
 }
 
+// PathWithExpiry builds the full URL to the image (including the host),
+// mixing an "expires=<unix-seconds>" parameter into the URL and its
+// signature so the URL stops validating after the given time. The expiry
+// is part of what gets signed, so it can't be tampered with independently
+// of the signature.
+func (c *Client) PathWithExpiry(imgPath string, params url.Values, expires time.Time) string {
+	u := url.URL{
+		Scheme: c.Scheme(),
+		Host:   c.Host(imgPath),
+	}
+
+	urlString := u.String()
+
+	// If we are given a fully-qualified URL, escape it per the note located
+	// near the `escape.ProxyPathEscape` function definition; otherwise escape
+	// it as an ordinary path per `escape.PathEscape`.
+	if RegexpHTTPAndS.MatchString(imgPath) {
+		imgPath = escape.ProxyPathEscape(imgPath)
+	} else {
+		imgPath = escape.PathEscape(imgPath)
+	}
+
+	// Add a leading slash if one does not exist:
+	//     "users/1.png" -> "/users/1.png"
+	if strings.Index(imgPath, "/") != 0 {
+		imgPath = "/" + imgPath
+	}
+
+	urlString += imgPath
+
+	paramsWithExpiry := cloneValues(params)
+	paramsWithExpiry.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+
+	// The signature in an imgix URL must always be the **last** parameter in a URL,
+	// hence some of the gross string concatenation here. net/url will aggressively
+	// alphabetize the URL parameters.
+	signature := c.SignatureForPathAndParamsWithExpiry(imgPath, params, expires)
+	parameterString := paramsWithExpiry.Encode()
+	parameterString = strings.Replace(parameterString, "+", "%20", -1)
+
+	if signature != "" {
+		parameterString += "&" + signature
+	}
+
+	urlString += "?" + parameterString
+
+	return urlString
+}
+
+// ValidateSignedURL verifies that rawURL carries a signature matching this
+// client's token and, when the URL carries an "expires" parameter (as
+// produced by PathWithExpiry), that now is not after that expiry. It returns
+// a non-nil error describing the first problem found.
+func (c *Client) ValidateSignedURL(rawURL string, now time.Time) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("imgix: could not parse URL %q: %v", rawURL, err)
+	}
+
+	query := parsed.Query()
+	gotSignature := query.Get("s")
+	if gotSignature == "" {
+		return fmt.Errorf("imgix: URL %q has no signature", rawURL)
+	}
+	query.Del("s")
+
+	var wantSignature string
+	if expiresParam := query.Get("expires"); expiresParam != "" {
+		expiresUnix, err := strconv.ParseInt(expiresParam, 10, 64)
+		if err != nil {
+			return fmt.Errorf("imgix: invalid expires parameter %q: %v", expiresParam, err)
+		}
+
+		expires := time.Unix(expiresUnix, 0)
+		if now.After(expires) {
+			return fmt.Errorf("imgix: URL expired at %s", expires)
+		}
+
+		query.Del("expires")
+		wantSignature = c.SignatureForPathAndParamsWithExpiry(parsed.EscapedPath(), query, expires)
+	} else {
+		wantSignature = c.SignatureForPathAndParams(parsed.EscapedPath(), query)
+	}
+
+	if wantSignature != "s="+gotSignature {
+		return fmt.Errorf("imgix: signature mismatch for URL %q", rawURL)
+	}
+
+	return nil
+}
+
+// cloneValues returns a copy of params so callers can mutate the result
+// without affecting the caller's url.Values.
+func cloneValues(params url.Values) url.Values {
+	cloned := make(url.Values, len(params))
+	for key, values := range params {
+		cloned[key] = append([]string(nil), values...)
+	}
+	return cloned
+}
+
 func (c *Client) crc32BasedIndexForPath(path string) int {
 	crc := crc32.ChecksumIEEE([]byte(path))
 	return int(crc) % len(c.hosts)
 }
-
-// This code is less than ideal, but it's the only way we've found out how to do it
-// give Go's URL capabilities and escaping behavior.
-//
-// This method replicates the beavhior of Ruby's CGI::escape in Go.
-//
-// Here is that method:
-//
-//     def CGI::escape(string)
-//       string.gsub(/([^ a-zA-Z0-9_.-]+)/) do
-//         '%' + $1.unpack('H2' * $1.bytesize).join('%').upcase
-//       end.tr(' ', '+')
-//      end
-//
-// It replaces
-//
-// See:
-//  - https://github.com/parkr/imgix-go/pull/1#issuecomment-109014369
-//  - https://github.com/imgix/imgix-blueprint#securing-urls
-func cgiEscape(s string) string {
-	return RegexUrlCharactersToEscape.ReplaceAllStringFunc(s, func(s string) string {
-		rune, _ := utf8.DecodeLastRuneInString(s)
-		return "%" + strings.ToUpper(fmt.Sprintf("%x", rune))
-	})
-}
@@ -3,6 +3,7 @@ package imgix
 import (
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -69,6 +70,31 @@ func TestClientFullyQualifiedUrlPathWithParams(t *testing.T) {
 	assert.Equal(t, "https://my-social-network.imgix.net/http%3A%2F%2Favatars.com%2Fjohn-smith.png?h=300&w=400&s=a201fe1a3caef4944dcb40f6ce99e746", c.PathWithParams("http://avatars.com/john-smith.png", params))
 }
 
+func TestClientFullyQualifiedUrlPathWithOwnQueryString(t *testing.T) {
+	c := testClientWithToken()
+	assert.Equal(t, "https://my-social-network.imgix.net/http%3A%2F%2Favatars.com%2Fjohn-smith.png%3Fw%3D400%26h%3D300?s=0bc827b772bc04f2991204fb86874376", c.Path("http://avatars.com/john-smith.png?w=400&h=300"))
+}
+
+func TestClientPathWithNonASCIIFilename(t *testing.T) {
+	c := testClient()
+	u := c.Path("/users/café.png")
+	assert.Equal(t, "https://prod.imgix.net/users/caf%C3%A9.png", u)
+
+	parsed, err := url.Parse(u)
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/café.png", parsed.Path)
+}
+
+func TestClientPathWithSpaceInFilename(t *testing.T) {
+	c := testClient()
+	u := c.Path("/users/my file.png")
+	assert.Equal(t, "https://prod.imgix.net/users/my%20file.png", u)
+
+	parsed, err := url.Parse(u)
+	assert.NoError(t, err)
+	assert.Equal(t, "/users/my file.png", parsed.Path)
+}
+
 func TestClientFallbackShardStrategy(t *testing.T) {
 	c := testClient()
 	assert.Equal(t, ShardStrategy(""), c.shardStrategy)
@@ -105,6 +131,124 @@ func TestClientShardStrategyValidation(t *testing.T) {
 	c.ShardStrategy()
 }
 
+func TestClientPathWithExpiry(t *testing.T) {
+	c := testClientWithToken()
+	expires := time.Unix(1516060800, 0)
+	u := c.PathWithExpiry("/users/1.png", url.Values{}, expires)
+	assert.Equal(t, "https://my-social-network.imgix.net/users/1.png?expires=1516060800&s=34a294b01b30616d84c4c7a6f09720d9", u)
+}
+
+func TestClientPathWithExpiryAndParams(t *testing.T) {
+	c := testClientWithToken()
+	expires := time.Unix(1516060800, 0)
+	params := url.Values{"w": []string{"400"}, "h": []string{"300"}}
+	u := c.PathWithExpiry("/users/1.png", params, expires)
+	assert.Equal(t, "https://my-social-network.imgix.net/users/1.png?expires=1516060800&h=300&w=400&s=a6dabce0f9e281be9cf6e351901d868c", u)
+}
+
+func TestClientValidateSignedURL(t *testing.T) {
+	c := testClientWithToken()
+	u := c.Path("/users/1.png")
+	assert.NoError(t, c.ValidateSignedURL(u, time.Now()))
+}
+
+func TestClientValidateSignedURLWithExpiry(t *testing.T) {
+	c := testClientWithToken()
+	expires := time.Unix(1516060800, 0)
+	u := c.PathWithExpiry("/users/1.png", url.Values{}, expires)
+
+	assert.NoError(t, c.ValidateSignedURL(u, expires.Add(-time.Minute)))
+	assert.Error(t, c.ValidateSignedURL(u, expires.Add(time.Minute)))
+}
+
+func TestClientValidateSignedURLTamperedSignature(t *testing.T) {
+	c := testClientWithToken()
+	u := c.Path("/users/1.png")
+	assert.Error(t, c.ValidateSignedURL(u+"tampered", time.Now()))
+}
+
+func TestClientValidateSignedURLFullyQualifiedUrlPath(t *testing.T) {
+	c := testClientWithToken()
+	u := c.Path("http://avatars.com/john-smith.png?w=400&h=300")
+	assert.NoError(t, c.ValidateSignedURL(u, time.Now()))
+}
+
+func TestClientValidateSignedURLWithSpaceInPath(t *testing.T) {
+	c := testClientWithToken()
+	u := c.Path("/users/my file.png")
+	assert.NoError(t, c.ValidateSignedURL(u, time.Now()))
+}
+
+func TestClientValidateSignedURLWithNonASCIIPath(t *testing.T) {
+	c := testClientWithToken()
+	u := c.Path("/users/café.png")
+	assert.NoError(t, c.ValidateSignedURL(u, time.Now()))
+}
+
+func TestClientValidateSignedURLWithSpaceInParam(t *testing.T) {
+	c := testClientWithToken()
+	params := url.Values{"fit": []string{"crop top"}}
+	u := c.PathWithParams("/users/1.png", params)
+	assert.NoError(t, c.ValidateSignedURL(u, time.Now()))
+}
+
+func TestClientDefaultExpiry(t *testing.T) {
+	c := testClientWithToken()
+	c.DefaultExpiry = time.Hour
+	u := c.Path("/users/1.png")
+	assert.Contains(t, u, "expires=")
+	assert.NoError(t, c.ValidateSignedURL(u, time.Now()))
+}
+
+func TestClientDefaultSignatureAlgorithm(t *testing.T) {
+	c := testClientWithToken()
+	assert.Equal(t, SignatureAlgorithm(""), c.signatureAlgorithm)
+	assert.Equal(t, SignatureMD5, c.SignatureAlgorithm())
+}
+
+func TestClientPathWithHMACSHA256Signature(t *testing.T) {
+	c := NewClientWithTokenAndAlgorithm("my-social-network.imgix.net", "FOO123bar", SignatureHMACSHA256)
+	u := c.Path("/users/1.png")
+	assert.Equal(t, "https://my-social-network.imgix.net/users/1.png?s=4ba23a37ddfd380b54478788273020dccfe96ae5fd7f1fcb2d427713978232f8", u)
+}
+
+func TestClientPathWithHMACSHA256SignatureAndParams(t *testing.T) {
+	c := NewClientWithTokenAndAlgorithm("my-social-network.imgix.net", "FOO123bar", SignatureHMACSHA256)
+	params := url.Values{"w": []string{"400"}, "h": []string{"300"}}
+	u := c.PathWithParams("/users/1.png", params)
+	assert.Equal(t, "https://my-social-network.imgix.net/users/1.png?h=300&w=400&s=55206ecd1c11bdb537b9d7e1c98129a76f36ff9fd937d4117e23c962c0a1c2ae", u)
+}
+
+func TestClientSetSignatureAlgorithm(t *testing.T) {
+	c := testClientWithToken()
+	md5URL := c.Path("/users/1.png")
+
+	c.SetSignatureAlgorithm(SignatureHMACSHA256)
+	hmacURL := c.Path("/users/1.png")
+
+	assert.NotEqual(t, md5URL, hmacURL)
+}
+
+func TestClientValidateSignedURLWithHMACSHA256(t *testing.T) {
+	c := NewClientWithTokenAndAlgorithm("my-social-network.imgix.net", "FOO123bar", SignatureHMACSHA256)
+	u := c.Path("/users/1.png")
+	assert.NoError(t, c.ValidateSignedURL(u, time.Now()))
+}
+
+func TestClientSignatureAlgorithmValidation(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			assert.True(t, ok)
+			assert.EqualError(t, e, "signature algorithm 'sha1' is not supported")
+		}
+	}()
+
+	c := testClientWithToken()
+	c.signatureAlgorithm = SignatureAlgorithm("sha1")
+	c.SignatureAlgorithm()
+}
+
 func TestClientHostsCountValidation(t *testing.T) {
 	defer func() {
 		if r := recover(); r != nil {
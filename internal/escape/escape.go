@@ -0,0 +1,103 @@
+// Package escape implements the percent-encoding rules imgix-go needs when
+// hand-assembling URLs. The escape tables are adapted from Go's net/url
+// package: the standard library's PathEscape and QueryEscape encode a few
+// characters differently than imgix expects (see ProxyPathEscape below for
+// the proxied-URL case), so this is a small, imgix-flavored fork rather than
+// a wrapper around net/url.
+package escape
+
+import "strings"
+
+type mode int
+
+const (
+	pathMode mode = iota
+	queryMode
+	proxyPathMode
+)
+
+const upperhex = "0123456789ABCDEF"
+
+// isUnreserved reports whether c is an RFC 3986 unreserved character, which
+// is never escaped regardless of which part of the URL it appears in.
+func isUnreserved(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	case c == '-' || c == '_' || c == '.' || c == '~':
+		return true
+	}
+	return false
+}
+
+// shouldEscape reports whether c must be percent-encoded for the given part
+// of a URL.
+func shouldEscape(c byte, m mode) bool {
+	if isUnreserved(c) {
+		return false
+	}
+
+	if m == pathMode {
+		// RFC 3986's pchar also allows these sub-delims, ':' and '@',
+		// which keeps ordinary image paths readable.
+		switch c {
+		case '$', '&', '+', ',', '/', ':', ';', '=', '?', '@':
+			return false
+		}
+	}
+
+	return true
+}
+
+// escapeWithMode percent-encodes s one byte at a time, so a multi-byte
+// UTF-8 rune is correctly emitted as one %XX escape per byte rather than a
+// single escape for the whole codepoint.
+func escapeWithMode(s string, m mode) string {
+	hasEscapes := false
+	for i := 0; i < len(s); i++ {
+		if shouldEscape(s[i], m) {
+			hasEscapes = true
+			break
+		}
+	}
+	if !hasEscapes {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 2*strings.Count(s, "%"))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if shouldEscape(c, m) {
+			b.WriteByte('%')
+			b.WriteByte(upperhex[c>>4])
+			b.WriteByte(upperhex[c&15])
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// PathEscape percent-encodes s for use as (part of) a URL path, leaving the
+// RFC 3986 pchar delimiters -- such as '/' and ':' -- untouched so ordinary
+// image paths stay readable.
+func PathEscape(s string) string {
+	return escapeWithMode(s, pathMode)
+}
+
+// QueryEscape percent-encodes s for use as (part of) a URL query string.
+// Unlike net/url.QueryEscape, it leaves spaces escaped as "%20" rather than
+// rewriting them to "+".
+func QueryEscape(s string) string {
+	return escapeWithMode(s, queryMode)
+}
+
+// ProxyPathEscape percent-encodes a fully-qualified source URL so it can be
+// embedded as the path of an imgix URL (imgix's URL-proxying feature).
+// Only RFC 3986 unreserved characters are left alone -- notably '/' and
+// ':' are escaped to %2F and %3A so the embedded URL can't be mistaken for
+// structure belonging to the imgix URL wrapping it.
+func ProxyPathEscape(s string) string {
+	return escapeWithMode(s, proxyPathMode)
+}
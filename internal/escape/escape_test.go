@@ -0,0 +1,38 @@
+package escape
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathEscapeLeavesReservedDelimiters(t *testing.T) {
+	assert.Equal(t, "users/1.png", PathEscape("users/1.png"))
+	assert.Equal(t, "a:b@c?d=e&f", PathEscape("a:b@c?d=e&f"))
+}
+
+func TestPathEscapeNonASCII(t *testing.T) {
+	// "café.png" -- 'é' is the two-byte UTF-8 sequence 0xC3 0xA9, and each
+	// byte must be escaped individually.
+	assert.Equal(t, "caf%C3%A9.png", PathEscape("café.png"))
+}
+
+func TestQueryEscapeLeavesSpaceEncoded(t *testing.T) {
+	assert.Equal(t, "a%20b", QueryEscape("a b"))
+}
+
+func TestQueryEscapeReservedCharacters(t *testing.T) {
+	assert.Equal(t, "a%3Db%26c", QueryEscape("a=b&c"))
+}
+
+func TestProxyPathEscape(t *testing.T) {
+	assert.Equal(t, "http%3A%2F%2Favatars.com%2Fjohn-smith.png", ProxyPathEscape("http://avatars.com/john-smith.png"))
+}
+
+func TestProxyPathEscapeNonASCII(t *testing.T) {
+	assert.Equal(t, "http%3A%2F%2Favatars.com%2Fcaf%C3%A9.png", ProxyPathEscape("http://avatars.com/café.png"))
+}
+
+func TestProxyPathEscapeWithQueryString(t *testing.T) {
+	assert.Equal(t, "http%3A%2F%2Favatars.com%2Fjohn-smith.png%3Fw%3D400%26h%3D300", ProxyPathEscape("http://avatars.com/john-smith.png?w=400&h=300"))
+}